@@ -0,0 +1,110 @@
+// cache.go
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheRoot returns the base directory for the content-addressed extraction
+// cache: $XDG_CACHE_HOME/wavs, falling back to ~/.cache/wavs.
+func cacheRoot() (string, error) {
+	if d := os.Getenv("XDG_CACHE_HOME"); d != "" {
+		return filepath.Join(d, "wavs"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir: %w", err)
+	}
+	return filepath.Join(home, ".cache", "wavs"), nil
+}
+
+// cacheDisabled reports whether WAVS_NO_CACHE opts out of the cache.
+func cacheDisabled() bool {
+	return os.Getenv("WAVS_NO_CACHE") == "1"
+}
+
+// cacheSubdir returns cacheRoot()/name, creating it and confirming it's
+// actually writable (MkdirAll can succeed on a dir we don't own).
+func cacheSubdir(name string) (string, error) {
+	root, err := cacheRoot()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	probe := filepath.Join(dir, ".write-test")
+	f, err := os.OpenFile(probe, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	os.Remove(probe)
+	return dir, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedExtract returns the path to data under dir/<sha256 of data>,
+// writing it there first if it isn't already present (or doesn't match).
+// Concurrent callers are serialized with a directory-level flock so they
+// don't race on the same entry; the write itself is made atomic with a
+// .tmp file plus rename so a crash mid-write can't leave a corrupt entry.
+func cachedExtract(dir string, data []byte, perm os.FileMode) (path string, err error) {
+	sum := sha256Hex(data)
+	destPath := filepath.Join(dir, sum)
+
+	unlock, err := lockDir(dir)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if existing, err := hashFile(destPath); err == nil && existing == sum {
+		return destPath, nil
+	}
+
+	tmpPath := destPath + ".tmp"
+	os.Remove(tmpPath) // clear a leftover from a previous crashed writer
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return "", fmt.Errorf("create cache tmp file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("write cache tmp file: %w", err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("chmod cache tmp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("close cache tmp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("rename cache tmp file: %w", err)
+	}
+	return destPath, nil
+}
+
+// purgeExtractionCache removes the entire content-addressed cache, used by
+// the --purge-cache flag.
+func purgeExtractionCache() error {
+	root, err := cacheRoot()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(root)
+}
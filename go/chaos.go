@@ -0,0 +1,169 @@
+// chaos.go
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChaosConfig configures the fault injection chaosReader and freezeProcess
+// apply to a sidecar's stdio. It is loaded from wavs-chaos.toml when
+// WAVS_CHAOS=1, and every injected fault is logged with Seed so a run can
+// be reproduced.
+type ChaosConfig struct {
+	Seed                     int64
+	BandwidthBytesPerSec     int64
+	LatencyMin               time.Duration
+	LatencyMax               time.Duration
+	ShortReadProbability     float64
+	UnexpectedEOFProbability float64
+	FreezeInterval           time.Duration
+	FreezeDuration           time.Duration
+}
+
+// loadChaosConfig parses path as flat "key = value" lines: no nested
+// tables, just enough of TOML's grammar for a fault-injection profile.
+// Comments (#) and [section] headers are ignored.
+func loadChaosConfig(path string) (*ChaosConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		val := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		raw[key] = val
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &ChaosConfig{
+		Seed:                     parseChaosInt(raw["seed"], time.Now().UnixNano()),
+		BandwidthBytesPerSec:     parseChaosInt(raw["bandwidth_bytes_per_sec"], 0),
+		LatencyMin:               parseChaosDuration(raw["latency_min"], 0),
+		LatencyMax:               parseChaosDuration(raw["latency_max"], 0),
+		ShortReadProbability:     parseChaosFloat(raw["short_read_probability"], 0),
+		UnexpectedEOFProbability: parseChaosFloat(raw["unexpected_eof_probability"], 0),
+		FreezeInterval:           parseChaosDuration(raw["freeze_interval"], 0),
+		FreezeDuration:           parseChaosDuration(raw["freeze_duration"], 0),
+	}, nil
+}
+
+func parseChaosInt(s string, def int64) int64 {
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func parseChaosFloat(s string, def float64) float64 {
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func parseChaosDuration(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// chaosEnabled reports whether WAVS_CHAOS=1 requests fault injection.
+func chaosEnabled() bool {
+	return os.Getenv("WAVS_CHAOS") == "1"
+}
+
+// chaosReader wraps an io.Reader, injecting bandwidth throttling, latency
+// jitter, random short reads, and io.ErrUnexpectedEOF according to cfg.
+// Used to make sure downstream log consumers (and WAVS components reading
+// our streams) tolerate a slow or broken link without needing external
+// tools, in the spirit of the linkio ChaosMonkey pattern.
+type chaosReader struct {
+	r   io.Reader
+	cfg *ChaosConfig
+	tag string
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newChaosReader(r io.Reader, cfg *ChaosConfig, tag string) *chaosReader {
+	return &chaosReader{r: r, cfg: cfg, tag: tag, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+func (c *chaosReader) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.LatencyMax > 0 {
+		jitter := c.cfg.LatencyMin
+		if span := c.cfg.LatencyMax - c.cfg.LatencyMin; span > 0 {
+			jitter += time.Duration(c.rng.Int63n(int64(span)))
+		}
+		log.Printf("chaos[%s seed=%d]: injecting %s latency", c.tag, c.cfg.Seed, jitter)
+		time.Sleep(jitter)
+	}
+
+	if c.cfg.UnexpectedEOFProbability > 0 && c.rng.Float64() < c.cfg.UnexpectedEOFProbability {
+		log.Printf("chaos[%s seed=%d]: injecting io.ErrUnexpectedEOF", c.tag, c.cfg.Seed)
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	max := len(p)
+	if c.cfg.ShortReadProbability > 0 && max > 1 && c.rng.Float64() < c.cfg.ShortReadProbability {
+		short := 1 + c.rng.Intn(max-1)
+		log.Printf("chaos[%s seed=%d]: injecting short read (%d/%d bytes)", c.tag, c.cfg.Seed, short, max)
+		max = short
+	}
+
+	if c.cfg.BandwidthBytesPerSec > 0 {
+		const burst = 512
+		if max > burst {
+			max = burst
+		}
+	}
+
+	n, err := c.r.Read(p[:max])
+
+	if c.cfg.BandwidthBytesPerSec > 0 && n > 0 {
+		delay := time.Duration(n) * time.Second / time.Duration(c.cfg.BandwidthBytesPerSec)
+		log.Printf("chaos[%s seed=%d]: throttling %d bytes by %s", c.tag, c.cfg.Seed, n, delay)
+		time.Sleep(delay)
+	}
+
+	return n, err
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// freezeProcess sends SIGSTOP to cmd's process group every
+// cfg.FreezeInterval, holding it for cfg.FreezeDuration before SIGCONT, to
+// simulate a paused subprocess. It runs until stop is closed; a zero
+// FreezeInterval disables it entirely.
+func freezeProcess(cmd *exec.Cmd, cfg *ChaosConfig, stop <-chan struct{}) {
+	if cfg.FreezeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.FreezeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			log.Printf("chaos[freeze seed=%d]: pausing sidecar for %s", cfg.Seed, cfg.FreezeDuration)
+			forwardSignal(cmd, syscall.SIGSTOP)
+			select {
+			case <-time.After(cfg.FreezeDuration):
+			case <-stop:
+				forwardSignal(cmd, syscall.SIGCONT)
+				return
+			}
+			forwardSignal(cmd, syscall.SIGCONT)
+		}
+	}
+}
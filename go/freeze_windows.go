@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+	"os/exec"
+)
+
+// freezeProcess is unsupported on Windows: there's no SIGSTOP/SIGCONT
+// equivalent for an arbitrary child process, so a freeze profile is logged
+// and skipped rather than silently pretending to pause the sidecar.
+func freezeProcess(cmd *exec.Cmd, cfg *ChaosConfig, stop <-chan struct{}) {
+	if cfg.FreezeInterval <= 0 {
+		return
+	}
+	log.Printf("chaos[freeze seed=%d]: freeze injection is unsupported on windows, skipping", cfg.Seed)
+}
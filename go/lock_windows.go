@@ -0,0 +1,49 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 0x2
+
+// lockDir takes an exclusive lock on dir via LockFileEx, returning a func
+// that releases it. This is the Windows counterpart to the flock-based
+// lockDir in lock_unix.go.
+func lockDir(dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+
+	var overlapped syscall.Overlapped
+	ret, _, err := procLockFileEx.Call(
+		f.Fd(),
+		uintptr(lockfileExclusiveLock),
+		0,
+		^uintptr(0),
+		^uintptr(0),
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if ret == 0 {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", f.Name(), err)
+	}
+
+	return func() {
+		var overlapped syscall.Overlapped
+		procUnlockFileEx.Call(f.Fd(), 0, ^uintptr(0), ^uintptr(0), uintptr(unsafe.Pointer(&overlapped)))
+		f.Close()
+	}, nil
+}
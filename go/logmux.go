@@ -0,0 +1,462 @@
+// logmux.go
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRecord is one parsed line of sidecar output, tagged for routing and
+// filtering by LogMultiplexer's sinks and websocket subscribers.
+type LogRecord struct {
+	Seq    uint64                 `json:"seq"`
+	Time   time.Time              `json:"time"`
+	Stream string                 `json:"stream"` // "stdout" or "stderr"
+	PID    int                    `json:"pid"`
+	Raw    string                 `json:"raw"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// LogSink receives every record published by a LogMultiplexer.
+type LogSink interface {
+	Write(rec LogRecord)
+}
+
+const logRingSize = 2000
+
+// LogMultiplexer replaces the old print-and-forget readOutput loop: it
+// parses each sidecar line, tags it, fans it out to a set of sinks, and
+// serves a websocket endpoint so the backlog and live tail can be watched
+// remotely, the way a kubernetes logs sidecar exposes container output.
+type LogMultiplexer struct {
+	mu    sync.Mutex
+	seq   uint64
+	ring  *logRingSink
+	sinks []LogSink
+	subs  map[chan LogRecord]struct{}
+}
+
+// NewLogMultiplexer sets up the stdout, rotating-file, and ring-buffer
+// sinks, storing logs under dataDir/logs.
+func NewLogMultiplexer(dataDir string) (*LogMultiplexer, error) {
+	fs, err := newLogFileSink(filepath.Join(dataDir, "logs"))
+	if err != nil {
+		return nil, fmt.Errorf("init log file sink: %w", err)
+	}
+	ring := newLogRingSink(logRingSize)
+	return &LogMultiplexer{
+		ring:  ring,
+		sinks: []LogSink{logStdoutSink{}, fs, ring},
+		subs:  make(map[chan LogRecord]struct{}),
+	}, nil
+}
+
+// Attach scans stdout/stderr from one sidecar generation and publishes each
+// line as a LogRecord tagged with pid.
+func (m *LogMultiplexer) Attach(stdout, stderr io.Reader, pid int) {
+	go m.scan(stdout, "stdout", pid)
+	go m.scan(stderr, "stderr", pid)
+}
+
+func (m *LogMultiplexer) scan(r io.Reader, stream string, pid int) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m.publish(stream, pid, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading %s: %v", stream, err)
+	}
+}
+
+func (m *LogMultiplexer) publish(stream string, pid int, line string) {
+	m.mu.Lock()
+	m.seq++
+	rec := LogRecord{Seq: m.seq, Time: time.Now(), Stream: stream, PID: pid, Raw: line}
+	m.mu.Unlock()
+
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err == nil {
+			rec.Fields = fields
+		}
+	}
+
+	for _, sink := range m.sinks {
+		sink.Write(rec)
+	}
+
+	m.mu.Lock()
+	subs := make([]chan LogRecord, 0, len(m.subs))
+	for ch := range m.subs {
+		subs = append(subs, ch)
+	}
+	m.mu.Unlock()
+	for _, ch := range subs {
+		select {
+		case ch <- rec:
+		default:
+			// Slow subscriber; drop rather than block the publisher.
+		}
+	}
+}
+
+func (m *LogMultiplexer) backlog() []LogRecord {
+	return m.ring.snapshot()
+}
+
+func (m *LogMultiplexer) subscribe() chan LogRecord {
+	ch := make(chan LogRecord, 256)
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+	return ch
+}
+
+func (m *LogMultiplexer) unsubscribe(ch chan LogRecord) {
+	m.mu.Lock()
+	delete(m.subs, ch)
+	m.mu.Unlock()
+	close(ch)
+}
+
+// ListenAndServe serves the /logs websocket endpoint on addr.
+func (m *LogMultiplexer) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs", m.handleLogs)
+	return http.ListenAndServe(addr, mux)
+}
+
+// handleLogs upgrades the request to a websocket and streams the ring
+// buffer backlog followed by the live tail, applying ?stream= and ?grep=
+// filters server-side before anything is written to the socket.
+func (m *LogMultiplexer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	streamFilter := r.URL.Query().Get("stream")
+
+	var grepRe *regexp.Regexp
+	if g := r.URL.Query().Get("grep"); g != "" {
+		re, err := regexp.Compile(g)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid grep: %v", err), http.StatusBadRequest)
+			return
+		}
+		grepRe = re
+	}
+	match := func(rec LogRecord) bool {
+		if streamFilter != "" && rec.Stream != streamFilter {
+			return false
+		}
+		if grepRe != nil && !grepRe.MatchString(rec.Raw) {
+			return false
+		}
+		return true
+	}
+
+	conn, rw, err := wsHandshake(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer conn.Close()
+
+	sub := m.subscribe()
+	defer m.unsubscribe(sub)
+
+	for _, rec := range m.backlog() {
+		if !match(rec) {
+			continue
+		}
+		if err := wsWriteText(rw, recordJSON(rec)); err != nil {
+			return
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("recovered panic reading websocket frame: %v", r)
+			}
+		}()
+		for {
+			opcode, _, err := wsReadFrame(rw.Reader)
+			if err != nil || opcode == wsOpClose {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case rec, ok := <-sub:
+			if !ok {
+				return
+			}
+			if !match(rec) {
+				continue
+			}
+			if err := wsWriteText(rw, recordJSON(rec)); err != nil {
+				return
+			}
+			if err := rw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func recordJSON(rec LogRecord) []byte {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return []byte(fmt.Sprintf(`{"seq":%d,"stream":%q,"pid":%d,"raw":%q}`, rec.Seq, rec.Stream, rec.PID, rec.Raw))
+	}
+	return b
+}
+
+// logStdoutSink is the pretty-printer that replaces the old "[WAVS] line"
+// prefix output.
+type logStdoutSink struct{}
+
+func (logStdoutSink) Write(rec LogRecord) {
+	tag := "WAVS"
+	if rec.Stream == "stderr" {
+		tag = "WAVS-ERR"
+	}
+	fmt.Printf("[%s pid=%d #%d] %s\n", tag, rec.PID, rec.Seq, rec.Raw)
+}
+
+// logFileSink appends records as JSON lines under dir, rotating to a new
+// file once the current one passes maxBytes.
+type logFileSink struct {
+	mu       sync.Mutex
+	dir      string
+	file     *os.File
+	written  int64
+	maxBytes int64
+}
+
+func newLogFileSink(dir string) (*logFileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fs := &logFileSink{dir: dir, maxBytes: 10 << 20}
+	if err := fs.rotate(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *logFileSink) rotate() error {
+	if fs.file != nil {
+		fs.file.Close()
+	}
+	name := filepath.Join(fs.dir, fmt.Sprintf("wavs-%s.log", time.Now().Format("20060102-150405.000000")))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fs.file = f
+	fs.written = 0
+	return nil
+}
+
+func (fs *logFileSink) Write(rec LogRecord) {
+	line := append(recordJSON(rec), '\n')
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.written+int64(len(line)) > fs.maxBytes {
+		if err := fs.rotate(); err != nil {
+			log.Printf("log rotation failed: %v", err)
+			return
+		}
+	}
+	n, err := fs.file.Write(line)
+	if err != nil {
+		log.Printf("write log file: %v", err)
+		return
+	}
+	fs.written += int64(n)
+}
+
+// logRingSink keeps the last size records in memory for new websocket
+// subscribers to replay as backlog.
+type logRingSink struct {
+	mu   sync.Mutex
+	buf  []LogRecord
+	size int
+	next int
+	full bool
+}
+
+func newLogRingSink(size int) *logRingSink {
+	return &logRingSink{buf: make([]LogRecord, size), size: size}
+}
+
+func (r *logRingSink) Write(rec LogRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = rec
+	r.next = (r.next + 1) % r.size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *logRingSink) snapshot() []LogRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		out := make([]LogRecord, r.next)
+		copy(out, r.buf[:r.next])
+		return out
+	}
+	out := make([]LogRecord, r.size)
+	copy(out, r.buf[r.next:])
+	copy(out[r.size-r.next:], r.buf[:r.next])
+	return out
+}
+
+// --- minimal RFC 6455 server-side websocket support (no external deps) ---
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+const wsOpClose = 0x8
+
+// maxWSFrameBytes bounds the length a client frame header can claim before
+// we allocate a buffer for it. Log-viewer clients only ever send tiny
+// control frames (pings, the close handshake); anything claiming more than
+// this is a malformed or hostile frame, not a real one.
+const maxWSFrameBytes = 4 << 20 // 4MiB
+
+// wsHandshake hijacks the HTTP connection and completes the websocket
+// upgrade handshake, returning the raw connection for framing.
+func wsHandshake(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, nil, fmt.Errorf("not a websocket upgrade request")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, nil, fmt.Errorf("missing Sec-WebSocket-Key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+	if _, err := rw.WriteString(resp); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
+
+// wsWriteText writes payload as a single unmasked text frame (server frames
+// are never masked per RFC 6455).
+func wsWriteText(w io.Writer, payload []byte) error {
+	length := len(payload)
+	var header []byte
+	switch {
+	case length <= 125:
+		header = []byte{0x81, byte(length)}
+	case length <= 65535:
+		header = []byte{0x81, 126, byte(length >> 8), byte(length)}
+	default:
+		header = make([]byte, 10)
+		header[0] = 0x81
+		header[1] = 127
+		for i := 0; i < 8; i++ {
+			header[9-i] = byte(length >> (8 * i))
+		}
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// wsReadFrame reads one client frame, unmasking the payload as required by
+// the spec for client-to-server frames.
+func wsReadFrame(r *bufio.Reader) (opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = int64(ext[0])<<8 | int64(ext[1])
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range ext {
+			length = length<<8 | int64(b)
+		}
+	}
+
+	if length < 0 || length > maxWSFrameBytes {
+		return 0, nil, fmt.Errorf("frame too large: %d bytes", length)
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, maskKey[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= maskKey[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
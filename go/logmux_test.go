@@ -0,0 +1,72 @@
+// logmux_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestLogRingSinkWraparound(t *testing.T) {
+	r := newLogRingSink(3)
+	for i := 0; i < 5; i++ {
+		r.Write(LogRecord{Raw: string(rune('a' + i))})
+	}
+
+	got := r.snapshot()
+	want := []string{"c", "d", "e"}
+	if len(got) != len(want) {
+		t.Fatalf("snapshot len = %d, want %d", len(got), len(want))
+	}
+	for i, rec := range got {
+		if rec.Raw != want[i] {
+			t.Errorf("snapshot[%d] = %q, want %q", i, rec.Raw, want[i])
+		}
+	}
+}
+
+func TestLogRingSinkBeforeFull(t *testing.T) {
+	r := newLogRingSink(3)
+	r.Write(LogRecord{Raw: "a"})
+	r.Write(LogRecord{Raw: "b"})
+
+	got := r.snapshot()
+	if len(got) != 2 || got[0].Raw != "a" || got[1].Raw != "b" {
+		t.Fatalf("snapshot = %+v, want [a b]", got)
+	}
+}
+
+func TestWsReadFrameMaskedText(t *testing.T) {
+	payload := []byte("hi")
+	mask := [4]byte{0x11, 0x22, 0x33, 0x44}
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	frame := append([]byte{0x81, 0x80 | byte(len(payload))}, mask[:]...)
+	frame = append(frame, masked...)
+
+	opcode, got, err := wsReadFrame(bufio.NewReader(bytes.NewReader(frame)))
+	if err != nil {
+		t.Fatalf("wsReadFrame: %v", err)
+	}
+	if opcode != 0x1 {
+		t.Errorf("opcode = %#x, want 0x1", opcode)
+	}
+	if string(got) != "hi" {
+		t.Errorf("payload = %q, want %q", got, "hi")
+	}
+}
+
+// TestWsReadFrameRejectsOversizedLength reproduces the one-packet DoS: a
+// client-claimed 64-bit length near math.MaxInt64 must be rejected before
+// wsReadFrame ever allocates a payload buffer for it.
+func TestWsReadFrameRejectsOversizedLength(t *testing.T) {
+	frame := []byte{0x81, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	frame = append(frame, 0, 0, 0, 0) // mask key; no payload follows
+
+	_, _, err := wsReadFrame(bufio.NewReader(bytes.NewReader(frame)))
+	if err == nil {
+		t.Fatal("wsReadFrame: expected error for oversized length, got nil")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setupProcessGroup puts the sidecar in its own process group so a forwarded
+// signal reaches anything it spawns too, and so we can still reach it by
+// pgid if it reparents away from us.
+func setupProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// forwardSignal delivers sig to the sidecar's whole process group so that
+// any descendants it has spawned are reached as well.
+func forwardSignal(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	if pgid, err := syscall.Getpgid(cmd.Process.Pid); err == nil {
+		syscall.Kill(-pgid, sig)
+		return
+	}
+	cmd.Process.Signal(sig)
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setupProcessGroup is a no-op on Windows: there's no pgid equivalent we can
+// attach here, so forwardSignal below settles for signaling the process
+// itself rather than a process tree.
+func setupProcessGroup(cmd *exec.Cmd) {}
+
+// forwardSignal delivers sig to the sidecar process. Go's os.Process.Signal
+// implements only os.Kill on Windows: SIGINT is passed on as os.Interrupt,
+// which returns an error and reaches nothing, and any other signal
+// hard-terminates the process.
+func forwardSignal(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	if sig == syscall.SIGINT {
+		cmd.Process.Signal(os.Interrupt)
+		return
+	}
+	cmd.Process.Kill()
+}
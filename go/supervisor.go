@@ -0,0 +1,449 @@
+// supervisor.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// restartPolicy controls whether the supervisor restarts the sidecar after
+// it exits on its own. See WAVS_RESTART.
+type restartPolicy string
+
+const (
+	restartAlways    restartPolicy = "always"
+	restartOnFailure restartPolicy = "on-failure"
+	restartNever     restartPolicy = "never"
+)
+
+const (
+	defaultGrace = 15 * time.Second
+	backoffMin   = 500 * time.Millisecond
+	backoffMax   = 30 * time.Second
+)
+
+// generation is one run of the embedded wavs binary. A hot upgrade promotes
+// a new generation without tearing down the Supervisor itself.
+type generation struct {
+	cmd     *exec.Cmd
+	binPath string
+	num     int
+	// ephemeral marks a binPath that is a one-off temp file (extraction
+	// cache unavailable, or a freshly fetched upgrade candidate) rather
+	// than a shared cache entry, so it should be removed once this
+	// generation exits.
+	ephemeral bool
+	// chaosStop, if non-nil, stops this generation's freezeProcess loop and
+	// must be closed once the generation exits.
+	chaosStop chan struct{}
+}
+
+// Supervisor runs the embedded wavs sidecar: it forwards signals to the
+// child, restarts it on unexpected exit, and lets an Upgrader hot-swap the
+// running binary without dropping the sidecar. The data directory and
+// extracted config are shared across every generation it starts.
+type Supervisor struct {
+	policy  restartPolicy
+	grace   time.Duration
+	dataDir string
+
+	mu         sync.Mutex
+	configPath string
+	current    *generation
+	genCount   int
+
+	shuttingDown atomic.Bool
+	sigCh        chan os.Signal
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+	logs         *LogMultiplexer
+	chaos        *ChaosConfig
+}
+
+// NewSupervisor builds a Supervisor configured from WAVS_RESTART/WAVS_GRACE.
+// If WAVS_CHAOS=1, it also loads wavs-chaos.toml and enables fault
+// injection on every generation's stdio.
+func NewSupervisor(dataDir string) (*Supervisor, error) {
+	logs, err := NewLogMultiplexer(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var chaos *ChaosConfig
+	if chaosEnabled() {
+		cfg, err := loadChaosConfig("./wavs-chaos.toml")
+		if err != nil {
+			log.Printf("WAVS_CHAOS=1 but failed to load wavs-chaos.toml, running without chaos: %v", err)
+		} else {
+			chaos = cfg
+			log.Printf("chaos injection enabled (seed=%d)", cfg.Seed)
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+	return &Supervisor{
+		policy:     restartPolicyFromEnv(),
+		grace:      graceFromEnv(),
+		dataDir:    dataDir,
+		sigCh:      sigCh,
+		shutdownCh: make(chan struct{}),
+		logs:       logs,
+		chaos:      chaos,
+	}, nil
+}
+
+// Current returns the generation currently being supervised, or nil if none
+// has been started yet.
+func (s *Supervisor) Current() *generation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *Supervisor) setCurrent(g *generation) {
+	s.mu.Lock()
+	s.current = g
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) swappedAway(g *generation) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current != g
+}
+
+// Run extracts the embedded config once, then starts and supervises
+// generations of the embedded binary until a shutdown signal is received or
+// the restart policy gives up.
+func (s *Supervisor) Run() error {
+	os.MkdirAll(s.dataDir, 0755)
+
+	configPath, configCleanup, err := extractConfig()
+	if err != nil {
+		return err
+	}
+	defer configCleanup()
+	s.mu.Lock()
+	s.configPath = configPath
+	s.mu.Unlock()
+
+	go s.relaySignals()
+
+	go func() {
+		addr := logAddrFromEnv()
+		if err := s.logs.ListenAndServe(addr); err != nil {
+			log.Printf("log server on %s stopped: %v", addr, err)
+		}
+	}()
+
+	if err := s.startFreshGeneration(); err != nil {
+		return err
+	}
+
+	var backoff time.Duration
+	for {
+		g := s.Current()
+		waitErr := g.cmd.Wait()
+		if g.ephemeral {
+			os.Remove(g.binPath)
+		}
+		if g.chaosStop != nil {
+			close(g.chaosStop)
+		}
+
+		if s.swappedAway(g) {
+			// An Upgrader already started and promoted a replacement while
+			// this generation was shutting down; keep supervising that one.
+			continue
+		}
+
+		if waitErr != nil {
+			log.Printf("Sidecar exited with error: %v", waitErr)
+		} else {
+			fmt.Println("Sidecar finished successfully.")
+		}
+
+		if s.shuttingDown.Load() {
+			return nil
+		}
+
+		switch {
+		case s.policy == restartNever:
+			if waitErr != nil {
+				// Return rather than os.Exit here: exiting mid-Run would skip
+				// the deferred configCleanup above and leak the fallback
+				// temp-file config. main exits non-zero once this error
+				// surfaces back to it.
+				return fmt.Errorf("sidecar exited with error, restart policy is never: %w", waitErr)
+			}
+			return nil
+		case s.policy == restartOnFailure && waitErr == nil:
+			return nil
+		}
+
+		backoff = nextBackoff(backoff)
+		log.Printf("Restarting sidecar in %s (policy=%s)", backoff, s.policy)
+		select {
+		case <-time.After(backoff):
+		case <-s.shutdownCh:
+		}
+		if s.shuttingDown.Load() {
+			return nil
+		}
+
+		if err := s.startFreshGeneration(); err != nil {
+			return err
+		}
+	}
+}
+
+// startFreshGeneration extracts a new copy of the embedded binary, starts
+// it, and promotes it to current. Used both for the initial start and for
+// restarts after an unexpected exit.
+func (s *Supervisor) startFreshGeneration() error {
+	binaryPath, ephemeral, err := extractEmbeddedBinary()
+	if err != nil {
+		return err
+	}
+	g, err := s.startGeneration(binaryPath, ephemeral)
+	if err != nil {
+		if ephemeral {
+			os.Remove(binaryPath)
+		}
+		return err
+	}
+	s.setCurrent(g)
+	fmt.Printf("Sidecar started with PID: %d\n", g.cmd.Process.Pid)
+	return nil
+}
+
+// startGeneration launches binaryPath against this Supervisor's shared
+// config and data dir, and attaches output readers for it. ephemeral marks
+// whether binPath should be removed once this generation exits.
+func (s *Supervisor) startGeneration(binaryPath string, ephemeral bool) (*generation, error) {
+	s.mu.Lock()
+	configPath := s.configPath
+	s.genCount++
+	num := s.genCount
+	s.mu.Unlock()
+
+	cmd := exec.Command(binaryPath, "--home", configPath, "--data", s.dataDir)
+	setupProcessGroup(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start sidecar: %w", err)
+	}
+
+	var (
+		out, errR io.Reader = stdout, stderr
+		chaosStop chan struct{}
+	)
+	if s.chaos != nil {
+		out = newChaosReader(stdout, s.chaos, fmt.Sprintf("gen%d-stdout", num))
+		errR = newChaosReader(stderr, s.chaos, fmt.Sprintf("gen%d-stderr", num))
+		chaosStop = make(chan struct{})
+		go freezeProcess(cmd, s.chaos, chaosStop)
+	}
+	s.logs.Attach(out, errR, cmd.Process.Pid)
+
+	return &generation{cmd: cmd, binPath: binaryPath, num: num, ephemeral: ephemeral, chaosStop: chaosStop}, nil
+}
+
+// SwapBinary starts a new generation from binaryPath alongside the one
+// currently running, waits for it to pass probe, then terminates the
+// previous generation and promotes the new one. If probe never succeeds,
+// the new generation is killed and the old one keeps running. binaryPath is
+// always a fetched, one-off file, so its generation is ephemeral.
+func (s *Supervisor) SwapBinary(binaryPath string, probe ReadinessProbe, readyTimeout time.Duration) error {
+	if err := os.Chmod(binaryPath, 0755); err != nil {
+		return fmt.Errorf("chmod new binary: %w", err)
+	}
+
+	old := s.Current()
+	g, err := s.startGeneration(binaryPath, true)
+	if err != nil {
+		return fmt.Errorf("start new generation: %w", err)
+	}
+
+	if probe != nil {
+		if err := probe(readyTimeout); err != nil {
+			forwardSignal(g.cmd, syscall.SIGKILL)
+			g.cmd.Wait()
+			os.Remove(binaryPath)
+			return fmt.Errorf("new generation failed readiness probe: %w", err)
+		}
+	}
+
+	s.setCurrent(g)
+
+	if old != nil {
+		log.Printf("promoting generation %d, stopping generation %d (PID %d)", g.num, old.num, old.cmd.Process.Pid)
+		forwardSignal(old.cmd, syscall.SIGTERM)
+	}
+	return nil
+}
+
+// relaySignals forwards signals trapped from the OS to whichever generation
+// is current at the time the signal arrives, escalating to SIGKILL if it
+// ignores the grace period. It is the sole reader of sigCh; Run's backoff
+// wait watches shutdownCh instead so the two never race over which one
+// consumes the signal.
+func (s *Supervisor) relaySignals() {
+	for sig := range s.sigCh {
+		sSig, ok := sig.(syscall.Signal)
+		if !ok {
+			continue
+		}
+		s.shuttingDown.Store(true)
+		s.shutdownOnce.Do(func() { close(s.shutdownCh) })
+		g := s.Current()
+		if g == nil {
+			continue
+		}
+		log.Printf("Received %s, forwarding to sidecar (grace %s)", sSig, s.grace)
+		forwardSignal(g.cmd, sSig)
+		go func(g *generation) {
+			time.Sleep(s.grace)
+			if s.swappedAway(g) {
+				return
+			}
+			log.Printf("Sidecar did not exit within grace period, sending SIGKILL")
+			forwardSignal(g.cmd, syscall.SIGKILL)
+		}(g)
+	}
+}
+
+// extractConfig places the embedded wavs.toml in the content-addressed
+// cache, falling back to a one-off temp file if the cache is disabled or
+// unavailable. The returned cleanup only removes the fallback temp file;
+// a cache entry outlives the process.
+func extractConfig() (path string, cleanup func(), err error) {
+	if p, ok := tryCachedExtract("cfg", wavsConfig, 0644); ok {
+		return p, func() {}, nil
+	}
+
+	tmpConfig, err := os.CreateTemp("", "wavs-*.toml")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp config: %v", err)
+	}
+	if _, err := tmpConfig.Write(wavsConfig); err != nil {
+		tmpConfig.Close()
+		os.Remove(tmpConfig.Name())
+		return "", nil, fmt.Errorf("failed to write config: %v", err)
+	}
+	path = tmpConfig.Name()
+	tmpConfig.Close()
+	return path, func() { os.Remove(path) }, nil
+}
+
+// extractEmbeddedBinary returns the path to the embedded wavs binary,
+// preferring the content-addressed cache over re-writing it on every
+// start. ephemeral reports whether the caller must remove the path once
+// the generation using it exits (true for the temp-file fallback).
+func extractEmbeddedBinary() (path string, ephemeral bool, err error) {
+	if p, ok := tryCachedExtract("bin", wavsBinary, 0755); ok {
+		return p, false, nil
+	}
+
+	tmpBinary, err := os.CreateTemp("", "wavs-*")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create temp binary: %v", err)
+	}
+	if _, err := tmpBinary.Write(wavsBinary); err != nil {
+		tmpBinary.Close()
+		os.Remove(tmpBinary.Name())
+		return "", false, fmt.Errorf("failed to write binary: %v", err)
+	}
+	if err := tmpBinary.Chmod(0755); err != nil {
+		tmpBinary.Close()
+		os.Remove(tmpBinary.Name())
+		return "", false, fmt.Errorf("failed to chmod binary: %v", err)
+	}
+	path = tmpBinary.Name()
+	tmpBinary.Close()
+	return path, true, nil
+}
+
+// tryCachedExtract attempts to serve data from the named cache subdir,
+// returning ok=false if caching is disabled or the cache is unusable for
+// any reason (the caller falls back to a temp file).
+func tryCachedExtract(subdir string, data []byte, perm os.FileMode) (path string, ok bool) {
+	if cacheDisabled() {
+		return "", false
+	}
+	dir, err := cacheSubdir(subdir)
+	if err != nil {
+		log.Printf("%s cache unavailable, falling back to temp file: %v", subdir, err)
+		return "", false
+	}
+	p, err := cachedExtract(dir, data, perm)
+	if err != nil {
+		log.Printf("%s cache unavailable, falling back to temp file: %v", subdir, err)
+		return "", false
+	}
+	return p, true
+}
+
+// logAddrFromEnv reads WAVS_LOG_ADDR, defaulting to ":9876".
+func logAddrFromEnv() string {
+	if v := os.Getenv("WAVS_LOG_ADDR"); v != "" {
+		return v
+	}
+	return ":9876"
+}
+
+// restartPolicyFromEnv reads WAVS_RESTART (always|on-failure|never),
+// defaulting to on-failure.
+func restartPolicyFromEnv() restartPolicy {
+	switch restartPolicy(os.Getenv("WAVS_RESTART")) {
+	case restartAlways:
+		return restartAlways
+	case restartNever:
+		return restartNever
+	default:
+		return restartOnFailure
+	}
+}
+
+// graceFromEnv reads WAVS_GRACE as a time.Duration string, defaulting to 15s.
+func graceFromEnv() time.Duration {
+	if v := os.Getenv("WAVS_GRACE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("invalid WAVS_GRACE %q, using default %s", v, defaultGrace)
+	}
+	return defaultGrace
+}
+
+// nextBackoff doubles the previous restart backoff (at least backoffMin,
+// capped at backoffMax) and returns a random duration between half of that
+// and all of it, so a flapping sidecar doesn't restart in lockstep.
+func nextBackoff(prev time.Duration) time.Duration {
+	next := prev * 2
+	if next < backoffMin {
+		next = backoffMin
+	}
+	if next > backoffMax {
+		next = backoffMax
+	}
+	return next/2 + time.Duration(rand.Int63n(int64(next)/2+1))
+}
@@ -0,0 +1,35 @@
+// supervisor_test.go
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoffBounds(t *testing.T) {
+	var backoff time.Duration
+	for i := 0; i < 20; i++ {
+		next := nextBackoff(backoff)
+		want := backoff * 2
+		if want < backoffMin {
+			want = backoffMin
+		}
+		if want > backoffMax {
+			want = backoffMax
+		}
+		if next < want/2 || next > want {
+			t.Fatalf("iteration %d: nextBackoff(%s) = %s, want in [%s, %s]", i, backoff, next, want/2, want)
+		}
+		backoff = next
+	}
+}
+
+func TestNextBackoffCapsAtMax(t *testing.T) {
+	backoff := backoffMax
+	for i := 0; i < 5; i++ {
+		backoff = nextBackoff(backoff)
+		if backoff > backoffMax {
+			t.Fatalf("nextBackoff exceeded backoffMax: %s > %s", backoff, backoffMax)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// upgrade.go
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Fetcher retrieves a candidate wavs binary and reports a checksum that
+// identifies it, so an Upgrader can tell when a new build becomes available.
+type Fetcher interface {
+	// Check reports the SHA256 checksum (hex-encoded) of the binary
+	// currently available from this source.
+	Check() (sha256Hex string, err error)
+	// Fetch downloads the binary identified by sha256Hex to destPath,
+	// verifying its checksum before returning.
+	Fetch(sha256Hex, destPath string) error
+}
+
+// LocalFetcher serves upgrade candidates from a file on disk, e.g. one
+// dropped by a build pipeline or config-management agent.
+type LocalFetcher struct {
+	Path string
+}
+
+func (f *LocalFetcher) Check() (string, error) {
+	h, err := hashFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("hash %s: %w", f.Path, err)
+	}
+	return h, nil
+}
+
+func (f *LocalFetcher) Fetch(sha256Hex, destPath string) error {
+	got, err := f.Check()
+	if err != nil {
+		return err
+	}
+	if got != sha256Hex {
+		return fmt.Errorf("local binary changed mid-fetch: expected %s, got %s", sha256Hex, got)
+	}
+	src, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return writeExecutable(src, destPath)
+}
+
+// HTTPFetcher downloads upgrade candidates over HTTP(S). It expects a
+// companion "<URL>.sha256" resource containing the hex-encoded checksum of
+// the binary, following the convention used by most Go release pipelines.
+type HTTPFetcher struct {
+	URL    string
+	Client *http.Client
+}
+
+func (f *HTTPFetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func (f *HTTPFetcher) Check() (string, error) {
+	resp, err := f.client().Get(f.URL + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch checksum: unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum response")
+	}
+	return fields[0], nil
+}
+
+func (f *HTTPFetcher) Fetch(sha256Hex, destPath string) error {
+	resp, err := f.client().Get(f.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch binary: unexpected status %s", resp.Status)
+	}
+
+	h := sha256.New()
+	if err := writeExecutable(io.TeeReader(resp.Body, h), destPath); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sha256Hex {
+		os.Remove(destPath)
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", sha256Hex, got)
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeExecutable(r io.Reader, destPath string) error {
+	out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ReadinessProbe reports whether a newly started sidecar generation is
+// ready to take over, blocking up to timeout before giving up.
+type ReadinessProbe func(timeout time.Duration) error
+
+// TCPReadinessProbe succeeds once it can open a TCP connection to addr.
+func TCPReadinessProbe(addr string) ReadinessProbe {
+	return func(timeout time.Duration) error {
+		deadline := time.Now().Add(timeout)
+		var lastErr error
+		for time.Now().Before(deadline) {
+			conn, err := net.DialTimeout("tcp", addr, time.Second)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+			lastErr = err
+			time.Sleep(200 * time.Millisecond)
+		}
+		return fmt.Errorf("not ready after %s: %w", timeout, lastErr)
+	}
+}
+
+// HTTPReadinessProbe succeeds once a GET to url returns a 2xx status, e.g.
+// the WAVS admin endpoint's health check.
+func HTTPReadinessProbe(url string) ReadinessProbe {
+	client := &http.Client{Timeout: 2 * time.Second}
+	return func(timeout time.Duration) error {
+		deadline := time.Now().Add(timeout)
+		var lastErr error
+		for time.Now().Before(deadline) {
+			resp, err := client.Get(url)
+			if err != nil {
+				lastErr = err
+			} else {
+				resp.Body.Close()
+				if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+					return nil
+				}
+				lastErr = fmt.Errorf("status %s", resp.Status)
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		return fmt.Errorf("not ready after %s: %w", timeout, lastErr)
+	}
+}
+
+// Upgrader periodically polls a Fetcher for a new wavs binary and, if one is
+// found, stages it and asks the Supervisor to swap it in.
+type Upgrader struct {
+	Fetcher      Fetcher
+	Supervisor   *Supervisor
+	Probe        ReadinessProbe
+	PollInterval time.Duration
+	ReadyTimeout time.Duration
+
+	currentSHA string
+}
+
+// NewUpgrader builds an Upgrader with reasonable default poll/ready timeouts.
+func NewUpgrader(f Fetcher, sup *Supervisor, probe ReadinessProbe) *Upgrader {
+	return &Upgrader{
+		Fetcher:      f,
+		Supervisor:   sup,
+		Probe:        probe,
+		PollInterval: 60 * time.Second,
+		ReadyTimeout: 30 * time.Second,
+	}
+}
+
+// Run polls for new binaries until stop is closed.
+func (u *Upgrader) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(u.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := u.checkOnce(); err != nil {
+				log.Printf("upgrade check failed: %v", err)
+			}
+		}
+	}
+}
+
+func (u *Upgrader) checkOnce() error {
+	sha, err := u.Fetcher.Check()
+	if err != nil {
+		return err
+	}
+	if u.currentSHA == "" {
+		// Until the first swap, the running binary is the embedded one.
+		u.currentSHA = sha256Hex(wavsBinary)
+	}
+	if sha == u.currentSHA {
+		return nil
+	}
+
+	log.Printf("new wavs binary detected (%s), staging upgrade", sha)
+	tmp, err := os.CreateTemp("", "wavs-upgrade-*")
+	if err != nil {
+		return fmt.Errorf("stage upgrade: %w", err)
+	}
+	path := tmp.Name()
+	tmp.Close()
+
+	if err := u.Fetcher.Fetch(sha, path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("fetch upgrade: %w", err)
+	}
+
+	if err := u.Supervisor.SwapBinary(path, u.Probe, u.ReadyTimeout); err != nil {
+		return fmt.Errorf("swap to new generation failed, keeping old: %w", err)
+	}
+
+	u.currentSHA = sha
+	log.Printf("upgraded running sidecar to %s", sha)
+	return nil
+}
+
+// upgraderFromEnv builds an Upgrader from WAVS_UPGRADE_* environment
+// variables, or returns nil if hot upgrades are not configured.
+func upgraderFromEnv(sup *Supervisor) *Upgrader {
+	var fetcher Fetcher
+	switch {
+	case os.Getenv("WAVS_UPGRADE_PATH") != "":
+		fetcher = &LocalFetcher{Path: os.Getenv("WAVS_UPGRADE_PATH")}
+	case os.Getenv("WAVS_UPGRADE_URL") != "":
+		fetcher = &HTTPFetcher{URL: os.Getenv("WAVS_UPGRADE_URL")}
+	default:
+		return nil
+	}
+
+	u := NewUpgrader(fetcher, sup, readinessProbeFromEnv())
+	if v := os.Getenv("WAVS_UPGRADE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			u.PollInterval = d
+		}
+	}
+	if v := os.Getenv("WAVS_UPGRADE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			u.ReadyTimeout = d
+		}
+	}
+	return u
+}
+
+// readinessProbeFromEnv parses WAVS_UPGRADE_PROBE, formatted as "tcp:addr"
+// or an "http(s)://" URL. Returns nil (no probe) if unset or invalid.
+func readinessProbeFromEnv() ReadinessProbe {
+	v := os.Getenv("WAVS_UPGRADE_PROBE")
+	switch {
+	case v == "":
+		return nil
+	case strings.HasPrefix(v, "tcp:"):
+		return TCPReadinessProbe(strings.TrimPrefix(v, "tcp:"))
+	case strings.HasPrefix(v, "http://"), strings.HasPrefix(v, "https://"):
+		return HTTPReadinessProbe(v)
+	default:
+		log.Printf("invalid WAVS_UPGRADE_PROBE %q, ignoring", v)
+		return nil
+	}
+}